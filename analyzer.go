@@ -0,0 +1,140 @@
+package main
+
+import (
+	"go/ast"
+	"sync"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+// Analyzer drives doPackage's per-package dead code detection through the
+// standard go/analysis pipeline, so it can be composed with other
+// analyzers under singlechecker/multichecker, plugged into `go vet
+// -vettool`, or surfaced live by gopls and staticcheck-style harnesses.
+//
+// Diagnostics are tagged with the same categories as the plain CLI output:
+// "unused" and "only-self-referential". Because go/analysis runs one
+// package at a time in dependency order with no mechanism for a package to
+// learn it's used by importers analyzed later, this mode has the same
+// horizon as the naive per-package CLI mode, not the cross-package
+// reachability of -whole (see whole.go). Use -whole for that; this
+// Analyzer exists to plug deadcode into driver-based tooling.
+var Analyzer = &analysis.Analyzer{
+	Name: "deadcode",
+	Doc:  "reports unused identifiers within a package",
+	Run:  runAnalyzer,
+}
+
+var wholeFlag *bool
+var wholeOnce sync.Once
+
+func init() {
+	wholeFlag = Analyzer.Flags.Bool("whole", false, "run -whole instead of the per-package analyzer (see deadcode -h)")
+}
+
+func runAnalyzer(pass *analysis.Pass) (interface{}, error) {
+	if *wholeFlag {
+		// Whole-program reachability doesn't fit the bottom-up,
+		// per-package Fact model go/analysis drivers use, so fall back
+		// to the dedicated loader from chunk 1 instead of trying to wire
+		// it through Run. Only do this once per process.
+		wholeOnce.Do(func() { doWhole([]string{"./..."}) })
+		return nil, nil
+	}
+
+	p := &Package{
+		fs:                  pass.Fset,
+		currentFuncName:     new(string),
+		decl:                make(map[string]ast.Node),
+		used:                make(map[string]bool),
+		funcSelfReferential: make(map[string]bool),
+		funcUsedOutsideBody: make(map[string]bool),
+	}
+	for _, file := range pass.Files {
+		collectFileDecls(p, file)
+	}
+	p.used["init"] = true
+	p.used["_"] = true
+	if pass.Pkg.Name() != "main" {
+		for name := range p.decl {
+			if ast.IsExported(barename(name)) {
+				p.used[barename(name)] = true
+			}
+		}
+	} else {
+		p.used["main"] = true
+	}
+	for _, file := range pass.Files {
+		ast.Walk(p, file)
+	}
+
+	for name, node := range p.decl {
+		bare := barename(name)
+		if _, ok := node.(*ast.FuncDecl); ok && p.used[bare] && !p.funcUsedOutsideBody[bare] && p.funcSelfReferential[bare] {
+			pass.Report(analysis.Diagnostic{
+				Pos:      node.Pos(),
+				Category: onlySelfReferentialCategory,
+				Message:  "func " + name + " is only used self-referentially",
+			})
+			continue
+		}
+		if !p.used[bare] {
+			pass.Report(analysis.Diagnostic{
+				Pos:      node.Pos(),
+				Category: unusedCategory,
+				Message:  name + " is unused",
+			})
+		}
+	}
+	return nil, nil
+}
+
+const (
+	unusedCategory              = "unused"
+	onlySelfReferentialCategory = "only-self-referential"
+)
+
+// collectFileDecls is doPackage's decl-gathering switch, factored out so
+// both the plain per-directory CLI and this Analyzer can share it.
+//
+// Struct fields and interface methods are deliberately not added here.
+// usedWalker marks every *ast.Ident it walks used, with no way to tell a
+// declaring occurrence from a referencing one; Visit's *ast.TypeSpec case
+// walks a struct/interface's body to catch field and method types using
+// other decls, which as a side effect marks the field/method names
+// themselves used by virtue of being declared. Tracking "Type.Field" and
+// "Type.Method" decl keys here without fixing that would make them
+// permanently, silently unreportable rather than actually detected; -whole
+// keys reachability off go/types.Info instead and doesn't have this
+// problem, so use it for unused-field/-method detection.
+func collectFileDecls(p *Package, file *ast.File) {
+	for _, decl := range file.Decls {
+		switch n := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range n.Specs {
+				switch s := spec.(type) {
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						p.decl[name.Name] = n
+					}
+				case *ast.TypeSpec:
+					p.decl[s.Name.Name] = n
+				}
+			}
+		case *ast.FuncDecl:
+			if n.Recv == nil {
+				p.decl[n.Name.Name] = n
+			} else {
+				p.decl[recvKey(n.Recv)+"."+n.Name.Name] = n
+			}
+		}
+	}
+}
+
+// runSinglechecker lets this binary also be invoked the way `go vet
+// -vettool` expects: as a process whose entire job is to run one
+// analysis.Analyzer over the patterns given on the command line.
+func runSinglechecker() {
+	singlechecker.Main(Analyzer)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+var (
+	buildTags   = cliFlags.String("tags", "", "comma-separated list of build tags to satisfy (same syntax as `go build -tags`)")
+	buildGOOS   = cliFlags.String("GOOS", runtime.GOOS, "GOOS to evaluate build constraints for")
+	buildGOARCH = cliFlags.String("GOARCH", runtime.GOARCH, "GOARCH to evaluate build constraints for")
+	generated   = cliFlags.Bool("generated", false, "also consider generated files (those whose first line matches \"// Code generated .* DO NOT EDIT.\")")
+	matrix      = cliFlags.String("matrix", "", "comma-separated list of GOOS/GOARCH pairs (e.g. linux/amd64,darwin/arm64); a symbol is only reported unused if it is unreachable in every configuration")
+)
+
+// generatedPattern matches the header line that `go generate`-produced
+// files are required to carry, per
+// https://go.dev/s/generatedcode.
+var generatedPattern = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// buildContext returns a go/build.Context for goos/goarch honoring -tags
+// and the CGO_ENABLED environment variable, so files gated behind
+// `//go:build` constraints for other platforms aren't parsed at all
+// instead of flooding decl with bogus entries.
+func buildContext(goos, goarch string) build.Context {
+	ctx := build.Default
+	ctx.GOOS = goos
+	ctx.GOARCH = goarch
+	if *buildTags != "" {
+		ctx.BuildTags = strings.Split(*buildTags, ",")
+	}
+	if v := os.Getenv("CGO_ENABLED"); v != "" {
+		ctx.CgoEnabled = v == "1"
+	}
+	return ctx
+}
+
+// isGenerated reports whether path's first line marks it as generated.
+func isGenerated(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	return scanner.Scan() && generatedPattern.MatchString(scanner.Text())
+}
+
+// loadDir parses the .go files in name that ctx's build constraints (GOOS,
+// GOARCH, tags, cgo) select, skipping generated files unless -generated is
+// set, and groups them into *ast.Packages the way parser.ParseDir did.
+func loadDir(fs *token.FileSet, ctx build.Context, name string) (map[string]*ast.Package, error) {
+	bpkg, err := ctx.ImportDir(name, 0)
+	if err != nil {
+		if _, ok := err.(*build.NoGoError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	names := bpkg.GoFiles
+	names = append(names, bpkg.CgoFiles...)
+
+	pkgs := make(map[string]*ast.Package)
+	for _, fname := range names {
+		if strings.HasSuffix(fname, "_test.go") {
+			continue
+		}
+		path := filepath.Join(name, fname)
+		if !*generated && isGenerated(path) {
+			continue
+		}
+		// ParseComments: the escape hatches in ignore.go (//go:linkname,
+		// // deadcode:keep) only exist as *ast.CommentGroups, which the
+		// parser drops unless asked to keep them.
+		file, err := parser.ParseFile(fs, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		pkg, ok := pkgs[file.Name.Name]
+		if !ok {
+			pkg = &ast.Package{Name: file.Name.Name, Files: make(map[string]*ast.File)}
+			pkgs[file.Name.Name] = pkg
+		}
+		pkg.Files[path] = file
+	}
+	return pkgs, nil
+}
+
+// doDir is doPackage's entry point for a single directory. Without -matrix
+// it analyzes name for one (GOOS, GOARCH, tags) configuration; with
+// -matrix it analyzes name once per configuration and reports a symbol as
+// unused only if every configuration that declares it agrees it's
+// unreachable, so cross-platform packages don't get false positives for
+// code that's merely dead on the configuration the tool happened to run
+// under.
+func doDir(name string) {
+	configs := []build.Context{buildContext(*buildGOOS, *buildGOARCH)}
+	if *matrix != "" {
+		configs = nil
+		for _, pair := range strings.Split(*matrix, ",") {
+			osarch := strings.SplitN(pair, "/", 2)
+			if len(osarch) != 2 {
+				errorf("invalid -matrix entry %q, want GOOS/GOARCH", pair)
+				continue
+			}
+			configs = append(configs, buildContext(osarch[0], osarch[1]))
+		}
+	}
+	if len(configs) == 1 {
+		doDirConfig(name, configs[0])
+		return
+	}
+	doDirMatrix(name, configs)
+}
+
+func doDirConfig(name string, ctx build.Context) {
+	fs := token.NewFileSet()
+	pkgs, err := loadDir(fs, ctx, name)
+	if err != nil {
+		errorf("%s", err)
+		return
+	}
+	for _, pkg := range pkgs {
+		doPackage(fs, pkg)
+	}
+}
+
+// declIdentity is a decl that's comparable across separate parses of the
+// same source (different build configurations parse the same file
+// independently, producing distinct ast.Nodes for the same declaration).
+type declIdentity struct {
+	pos  token.Position
+	name string
+}
+
+func doDirMatrix(name string, configs []build.Context) {
+	declared := make(map[declIdentity]bool)
+	usedAnywhere := make(map[declIdentity]bool)
+
+	for _, ctx := range configs {
+		fs := token.NewFileSet()
+		pkgs, err := loadDir(fs, ctx, name)
+		if err != nil {
+			errorf("%s", err)
+			continue
+		}
+		for _, pkg := range pkgs {
+			p := analyzePackage(fs, pkg)
+			for declName, node := range p.decl {
+				id := declIdentity{fs.Position(node.Pos()), declName}
+				declared[id] = true
+				if p.used[barename(declName)] {
+					usedAnywhere[id] = true
+				}
+			}
+		}
+	}
+
+	ids := make([]declIdentity, 0, len(declared))
+	for id := range declared {
+		if !usedAnywhere[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if ids[i].pos.Filename != ids[j].pos.Filename {
+			return ids[i].pos.Filename < ids[j].pos.Filename
+		}
+		return ids[i].pos.Line < ids[j].pos.Line
+	})
+	for _, id := range ids {
+		errorf("%s: %s is unused in every configuration", id.pos, id.name)
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"flag"
 	"fmt"
 	"go/ast"
-	"go/parser"
 	"go/token"
 	"os"
 	"sort"
@@ -13,12 +12,51 @@ import (
 
 var exitCode int
 
+// cliFlags holds every flag the plain CLI understands, kept off the
+// global flag.CommandLine so that routing into runSinglechecker (which
+// registers its own -tags et al. on flag.CommandLine) never collides with
+// ours.
+var cliFlags = flag.NewFlagSet("deadcode", flag.ExitOnError)
+
+var whole = cliFlags.Bool("whole", false, "run a whole-program, type-checked analysis across packages (accepts go/packages patterns, e.g. ./...)")
+
 func main() {
-	flag.Parse()
-	if flag.NArg() == 0 {
+	// `go vet -vettool=$(which deadcode)` (and other analysis.Analyzer
+	// drivers) probe a vettool binary with -V=full before doing anything
+	// else; route those invocations, and explicit -deadcode.vet ones, to
+	// the singlechecker wrapper around Analyzer instead of the CLI below.
+	for _, arg := range os.Args[1:] {
+		if arg == "-V=full" || arg == "-deadcode.vet" {
+			// -deadcode.vet is our own sentinel for manually exercising the
+			// singlechecker path; strip it before handing os.Args off, since
+			// singlechecker's flag set has never heard of it. -V=full is the
+			// real vettool probe and is left untouched, as singlechecker
+			// needs to see it to answer.
+			if arg == "-deadcode.vet" {
+				os.Args = append(os.Args[:1:1], without(os.Args[1:], "-deadcode.vet")...)
+			}
+			runSinglechecker()
+			return
+		}
+	}
+	cliFlags.Parse(os.Args[1:])
+	if *debugGraph != "" {
+		theGraph = newGraph()
+	}
+	if *ignoreListPath != "" {
+		il, err := loadIgnoreList(*ignoreListPath)
+		if err != nil {
+			errorf("-ignore: %s", err)
+			os.Exit(exitCode)
+		}
+		theIgnore = il
+	}
+	if *whole {
+		doWhole(cliFlags.Args())
+	} else if cliFlags.NArg() == 0 {
 		doDir(".")
 	} else {
-		for _, name := range flag.Args() {
+		for _, name := range cliFlags.Args() {
 			// Is it a directory?
 			if fi, err := os.Stat(name); err == nil && fi.IsDir() {
 				doDir(name)
@@ -27,9 +65,19 @@ func main() {
 			}
 		}
 	}
+	if theGraph != nil {
+		if err := theGraph.write(*debugGraph); err != nil {
+			errorf("writing -debug.graph: %s", err)
+		}
+	}
 	os.Exit(exitCode)
 }
 
+// theGraph is non-nil for the whole run when -debug.graph is set, and is
+// shared by every doPackage/doWhole call so a single file captures the
+// full picture across all packages processed.
+var theGraph *Graph
+
 // error formats the error to standard error, adding program
 // identification and a newline
 func errorf(format string, args ...interface{}) {
@@ -37,23 +85,15 @@ func errorf(format string, args ...interface{}) {
 	exitCode = 2
 }
 
-func doDir(name string) {
-	notests := func(info os.FileInfo) bool {
-		if !info.IsDir() && strings.HasSuffix(info.Name(), ".go") &&
-			!strings.HasSuffix(info.Name(), "_test.go") {
-			return true
+// without returns args with every element equal to s removed.
+func without(args []string, s string) []string {
+	out := args[:0:0]
+	for _, a := range args {
+		if a != s {
+			out = append(out, a)
 		}
-		return false
-	}
-	fs := token.NewFileSet()
-	pkgs, err := parser.ParseDir(fs, name, notests, parser.Mode(0))
-	if err != nil {
-		errorf("%s", err)
-		return
-	}
-	for _, pkg := range pkgs {
-		doPackage(fs, pkg)
 	}
+	return out
 }
 
 type Package struct {
@@ -64,9 +104,18 @@ type Package struct {
 	currentFuncName     *string
 	funcSelfReferential map[string]bool
 	funcUsedOutsideBody map[string]bool
+	graph               *Graph
 }
 
 func doPackage(fs *token.FileSet, pkg *ast.Package) {
+	reportPackage(fs, analyzePackage(fs, pkg))
+}
+
+// analyzePackage runs doPackage's decl/used walk without reporting, so
+// callers that need the raw result (e.g. the -tags/-GOOS/-GOARCH build
+// matrix in build.go, which unions results across configurations before
+// reporting) can get at it.
+func analyzePackage(fs *token.FileSet, pkg *ast.Package) *Package {
 	empty := ""
 	p := &Package{
 		p:                   pkg,
@@ -76,32 +125,10 @@ func doPackage(fs *token.FileSet, pkg *ast.Package) {
 		used:                make(map[string]bool),
 		funcSelfReferential: make(map[string]bool),
 		funcUsedOutsideBody: make(map[string]bool),
+		graph:               theGraph,
 	}
 	for _, file := range pkg.Files {
-		for _, decl := range file.Decls {
-			switch n := decl.(type) {
-			case *ast.GenDecl:
-				// var, const, types
-				for _, spec := range n.Specs {
-					switch s := spec.(type) {
-					case *ast.ValueSpec:
-						// constants and variables.
-						for _, name := range s.Names {
-							p.decl[name.Name] = n
-						}
-					case *ast.TypeSpec:
-						// type definitions.
-						p.decl[s.Name.Name] = n
-					}
-				}
-			case *ast.FuncDecl:
-				// function declarations
-				// TODO(remy): do methods
-				if n.Recv == nil {
-					p.decl[n.Name.Name] = n
-				}
-			}
-		}
+		collectFileDecls(p, file)
 	}
 	// init() and _ are always used
 	p.used["init"] = true
@@ -109,29 +136,72 @@ func doPackage(fs *token.FileSet, pkg *ast.Package) {
 	if pkg.Name != "main" {
 		// exported names are marked used for non-main packages.
 		for name := range p.decl {
-			if ast.IsExported(name) {
-				p.used[name] = true
+			if ast.IsExported(barename(name)) {
+				p.used[barename(name)] = true
+				p.graph.addRoot(barename(name))
 			}
 		}
 	} else {
 		// in main programs, main() is called.
 		p.used["main"] = true
+		p.graph.addRoot("main")
 	}
 	for _, file := range pkg.Files {
 		// walk file looking for used nodes.
 		ast.Walk(p, file)
 	}
-	// reports.
+	applyEscapeHatches(p, pkg)
+	return p
+}
+
+// applyEscapeHatches marks declarations used that doPackage's plain AST
+// walk can't see as reachable: //go:linkname directives (both ends),
+// // deadcode:keep pragmas, types passed to reflect.TypeOf/ValueOf, and
+// -ignore entries. These sit on top of the same p.used map the naive walk
+// populates.
+func applyEscapeHatches(p *Package, pkg *ast.Package) {
+	for _, file := range pkg.Files {
+		for _, name := range linknameTargets(file) {
+			p.used[name] = true
+		}
+		for _, name := range pragmaKeepNames(file) {
+			p.used[name] = true
+		}
+		for _, name := range reflectEscapes(file) {
+			// A type passed to reflect is commonly inspected by its
+			// (possibly exported-only) method set dynamically, so keep
+			// the type itself and every method declared on it alive,
+			// not just the type name.
+			p.used[name] = true
+			for declName := range p.decl {
+				if recv, method, ok := strings.Cut(declName, "."); ok && recv == name {
+					p.used[method] = true
+				}
+			}
+		}
+	}
+	for name := range p.decl {
+		bare := barename(name)
+		if theIgnore.matches(bare, name, pkg.Name+"."+name) {
+			p.used[bare] = true
+		}
+	}
+}
+
+// reportPackage emits the unused/only-self-referential reports for a
+// single analyzePackage result.
+func reportPackage(fs *token.FileSet, p *Package) {
 	reports := Reports(nil)
 	for name, node := range p.decl {
+		bare := barename(name)
 		if _, ok := node.(*ast.FuncDecl); ok {
-			if p.used[name] && !p.funcUsedOutsideBody[name] && p.funcSelfReferential[name] {
+			if p.used[bare] && !p.funcUsedOutsideBody[bare] && p.funcSelfReferential[bare] {
 				reports = append(reports, Report{node.Pos(), name, onlySelfReferential})
 
 				continue
 			}
 		}
-		if !p.used[name] {
+		if !p.used[bare] {
 			reports = append(reports, Report{node.Pos(), name, unused})
 		}
 	}
@@ -164,6 +234,52 @@ func (l Reports) Len() int           { return len(l) }
 func (l Reports) Less(i, j int) bool { return l[i].pos < l[j].pos }
 func (l Reports) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
 
+// barename strips the "recvType." or "typeName." qualifier off a decl key,
+// returning the bare identifier an *ast.Ident for it would carry. used,
+// funcSelfReferential and funcUsedOutsideBody are always keyed by this bare
+// name, since the AST walk below has no notion of a qualified selector.
+func barename(key string) string {
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		return key[i+1:]
+	}
+	return key
+}
+
+// recvKey returns the receiver type name of a method, stripping the
+// pointer star and any generic type parameters, e.g. "*Foo[T]" -> "Foo".
+func recvKey(recv *ast.FieldList) string {
+	expr := recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if idx, ok := expr.(*ast.IndexExpr); ok {
+		expr = idx.X
+	}
+	if idx, ok := expr.(*ast.IndexListExpr); ok {
+		expr = idx.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// embeddedName returns the name an embedded struct field is promoted
+// under, i.e. the type name itself, stripping pointers and package
+// qualifiers (`*pkg.Foo` embeds as "Foo").
+func embeddedName(expr ast.Expr) string {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.SelectorExpr:
+		return e.Sel.Name
+	}
+	return ""
+}
+
 // Visits files for used nodes.
 func (p *Package) Visit(node ast.Node) ast.Visitor {
 	u := usedWalker(*p) // hopefully p fields are references.
@@ -213,6 +329,11 @@ func (p *usedWalker) Visit(node ast.Node) ast.Visitor {
 		} else {
 			p.funcUsedOutsideBody[n.Name] = true
 		}
+		from := *p.currentFuncName
+		if from == "" {
+			from = "<package init>"
+		}
+		p.graph.addEdge(from, n.Name, p.fs.Position(n.Pos()).String())
 	}
 	return p
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// debugGraph, when set, makes every doPackage/doWhole run record the full
+// "kept-alive" reachability graph and dump it to the named file: one node
+// per declaration, edges from the referencing declaration to the
+// declaration it references, labeled with the file:line of the reference
+// that created the edge. Root nodes (main, init, exported-in-lib) are
+// flagged so they render distinctly.
+//
+// When a user disagrees with a report ("why is foo being kept alive?" or
+// "why isn't bar reported?"), they can grep the dump for the symbol and
+// trace the chain of edges back to a root.
+var debugGraph = cliFlags.String("debug.graph", "", "dump the reachability graph to this file (.json for JSON, anything else for Graphviz DOT)")
+
+// Graph is the reachability graph threaded through Visit/usedWalker.Visit
+// (and objGraph.mark, for -whole): every time a declaration is marked
+// used, an edge is recorded from whatever was being walked at the time to
+// the thing that got marked.
+type Graph struct {
+	roots map[string]bool
+	edges []graphEdge
+}
+
+type graphEdge struct {
+	From, To, At string
+}
+
+func newGraph() *Graph {
+	return &Graph{roots: make(map[string]bool)}
+}
+
+// addRoot flags name as a root of the reachability graph.
+func (g *Graph) addRoot(name string) {
+	if g == nil {
+		return
+	}
+	g.roots[name] = true
+}
+
+// addEdge records that from's definition references to, at position at
+// (typically a "file:line" string from token.FileSet.Position).
+func (g *Graph) addEdge(from, to, at string) {
+	if g == nil {
+		return
+	}
+	g.edges = append(g.edges, graphEdge{From: from, To: to, At: at})
+}
+
+// write dumps the graph to path, choosing DOT or JSON by file extension.
+func (g *Graph) write(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if strings.HasSuffix(path, ".json") {
+		return g.writeJSON(f)
+	}
+	return g.writeDOT(f)
+}
+
+func (g *Graph) writeJSON(w io.Writer) error {
+	type jsonGraph struct {
+		Roots []string    `json:"roots"`
+		Edges []graphEdge `json:"edges"`
+	}
+	jg := jsonGraph{Edges: g.edges}
+	for root := range g.roots {
+		jg.Roots = append(jg.Roots, root)
+	}
+	sort.Strings(jg.Roots)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jg)
+}
+
+func (g *Graph) writeDOT(w io.Writer) error {
+	fmt.Fprintln(w, "digraph deadcode {")
+	for root := range g.roots {
+		fmt.Fprintf(w, "\t%q [shape=box,style=filled,fillcolor=lightgrey];\n", root)
+	}
+	for _, e := range g.edges {
+		fmt.Fprintf(w, "\t%q -> %q [label=%q];\n", e.From, e.To, e.At)
+	}
+	fmt.Fprintln(w, "}")
+	return nil
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bufio"
+	"go/ast"
+	"go/token"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ignoreListPath names a file of newline-separated entries that force
+// their matching declarations to be treated as used, for symbols only
+// referenced through reflection, cgo, or other mechanisms this tool can't
+// see into. Each line is either a literal "pkg.Name" / "pkg.Type.Method"
+// identity, or a /regexp/ (delimited by slashes) matched against both the
+// bare and qualified forms. Blank lines and lines starting with # are
+// ignored.
+var ignoreListPath = cliFlags.String("ignore", "", "file of pkg.Name / pkg.Type.Method entries or /regexp/ patterns to force-mark as used")
+
+// theIgnore is loaded once in main if -ignore is set, and consulted by
+// both the naive per-package mode and -whole.
+var theIgnore *ignoreList
+
+type ignoreList struct {
+	literal  map[string]bool
+	patterns []*regexp.Regexp
+}
+
+func loadIgnoreList(path string) (*ignoreList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	il := &ignoreList{literal: make(map[string]bool)}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if len(line) > 1 && strings.HasPrefix(line, "/") && strings.HasSuffix(line, "/") {
+			re, err := regexp.Compile(line[1 : len(line)-1])
+			if err != nil {
+				return nil, err
+			}
+			il.patterns = append(il.patterns, re)
+			continue
+		}
+		il.literal[line] = true
+	}
+	return il, scanner.Err()
+}
+
+// matches reports whether any of names (typically a bare and a qualified
+// form of the same declaration) is covered by the ignore list.
+func (il *ignoreList) matches(names ...string) bool {
+	if il == nil {
+		return false
+	}
+	for _, name := range names {
+		if il.literal[name] {
+			return true
+		}
+		for _, re := range il.patterns {
+			if re.MatchString(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// linknameTargets scans file's comments for //go:linkname directives and
+// returns the identifier named on each side: `//go:linkname local remote`
+// keeps both ends alive, since the directive makes remote resolvable to
+// local's definition regardless of whether anything in this package calls
+// it by name.
+func linknameTargets(file *ast.File) []string {
+	var names []string
+	for _, cg := range file.Comments {
+		for _, c := range cg.List {
+			fields := strings.Fields(strings.TrimPrefix(c.Text, "//"))
+			if len(fields) < 2 || fields[0] != "go:linkname" {
+				continue
+			}
+			local := fields[1]
+			if i := strings.LastIndex(local, "."); i >= 0 {
+				local = local[i+1:]
+			}
+			names = append(names, local)
+			if len(fields) >= 3 {
+				remote := fields[2]
+				if i := strings.LastIndex(remote, "."); i >= 0 {
+					remote = remote[i+1:]
+				}
+				names = append(names, remote)
+			}
+		}
+	}
+	return names
+}
+
+// pragmaKeepNames returns the names of every declaration in file whose doc
+// comment carries a "// deadcode:keep" line, the pragma recognized during
+// the AST walk to force a single declaration to be treated as used without
+// needing an -ignore entry.
+func pragmaKeepNames(file *ast.File) []string {
+	var names []string
+	check := func(doc *ast.CommentGroup, add func()) {
+		if doc == nil {
+			return
+		}
+		for _, c := range doc.List {
+			if strings.TrimSpace(strings.TrimPrefix(c.Text, "//")) == "deadcode:keep" {
+				add()
+				return
+			}
+		}
+	}
+	for _, decl := range file.Decls {
+		switch n := decl.(type) {
+		case *ast.FuncDecl:
+			check(n.Doc, func() { names = append(names, n.Name.Name) })
+		case *ast.GenDecl:
+			check(n.Doc, func() {
+				for _, spec := range n.Specs {
+					switch s := spec.(type) {
+					case *ast.ValueSpec:
+						for _, name := range s.Names {
+							names = append(names, name.Name)
+						}
+					case *ast.TypeSpec:
+						names = append(names, s.Name.Name)
+					}
+				}
+			})
+			for _, spec := range n.Specs {
+				if s, ok := spec.(*ast.ValueSpec); ok {
+					check(s.Doc, func() {
+						for _, name := range s.Names {
+							names = append(names, name.Name)
+						}
+					})
+				}
+			}
+		}
+	}
+	return names
+}
+
+// reflectEscapes scans file for reflect.TypeOf(x)/reflect.ValueOf(x) calls
+// and returns the type name of x's static type where it can tell simply
+// (an *ast.Ident or &ast.Ident{} argument), on the assumption that a type
+// passed to reflect is likely inspected by name and its exported method
+// set driven dynamically.
+func reflectEscapes(file *ast.File) []string {
+	var names []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		pkg, ok := sel.X.(*ast.Ident)
+		if !ok || pkg.Name != "reflect" {
+			return true
+		}
+		if sel.Sel.Name != "TypeOf" && sel.Sel.Name != "ValueOf" {
+			return true
+		}
+		if len(call.Args) == 0 {
+			return true
+		}
+		if name := reflectArgTypeName(call.Args[0]); name != "" {
+			names = append(names, name)
+		}
+		return true
+	})
+	return names
+}
+
+// reflectArgTypeName extracts a type name from a reflect.TypeOf/ValueOf
+// argument expression when it's written as a composite literal, e.g.
+// reflect.TypeOf(Foo{}) or reflect.TypeOf(&Foo{}).
+func reflectArgTypeName(arg ast.Expr) string {
+	if u, ok := arg.(*ast.UnaryExpr); ok && u.Op == token.AND {
+		arg = u.X
+	}
+	lit, ok := arg.(*ast.CompositeLit)
+	if !ok {
+		return ""
+	}
+	return embeddedName(lit.Type)
+}
@@ -0,0 +1,809 @@
+package main
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// wholeProgramLoadMode is the packages.Load mode needed to type-check the
+// full program: syntax and type information for every package reachable
+// from the command-line patterns, plus their dependencies.
+const wholeProgramLoadMode = packages.NeedName | packages.NeedFiles |
+	packages.NeedCompiledGoFiles | packages.NeedImports | packages.NeedDeps |
+	packages.NeedTypes | packages.NeedTypesInfo | packages.NeedSyntax
+
+// doWhole runs the whole-program, type-checked analysis: it loads the
+// transitive closure of packages matched by patterns, type-checks them,
+// builds a reachability graph over the types.Objects they declare, and
+// reports every object that is not reachable from a root.
+//
+// Unlike doPackage, this mode understands scope and shadowing (it keys
+// off go/types.Info rather than identifier names) and crosses package
+// boundaries, so exported identifiers in non-root packages are only kept
+// alive when something actually uses them.
+func doWhole(patterns []string) {
+	cfg := &packages.Config{Mode: wholeProgramLoadMode, Tests: true}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		errorf("loading packages: %s", err)
+		return
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		exitCode = 2
+	}
+
+	g := newObjGraph(pkgs)
+	g.graph = theGraph
+	g.markRoots()
+	g.markEscapeHatches()
+
+	for _, r := range g.deadDecls() {
+		errorf("%s: %s is unused", r.pos, r.name)
+	}
+}
+
+// deadDecls returns every declaration in a root package (see rootPkgs)
+// that never became reachable, sorted by position.
+//
+// With Tests:true, packages.Load hands back the test-augmented variant
+// of a package alongside its base variant: two distinct *types.Package
+// instances type-checked from (mostly) the same source files, so every
+// package-level decl shows up as two distinct types.Objects. A decl used
+// only by a same-package test marks the test variant's object, leaving
+// the base variant's object of the identical source declaration
+// unmarked, so this dedupes by source position (anyVariantUsed/declKey)
+// and reports a decl dead only once, and only when none of its variants
+// were reached.
+func (g *objGraph) deadDecls() objReports {
+	var reports objReports
+	reported := make(map[string]bool)
+	for obj, decl := range g.decls {
+		if !g.rootPkgs[obj.Pkg()] || g.anyVariantUsed(obj) {
+			continue
+		}
+		key := g.declKey(obj)
+		if reported[key] {
+			continue
+		}
+		reported[key] = true
+		pos := token.Position{}
+		if fset := g.fsetFor(obj); fset != nil {
+			pos = fset.Position(decl.Pos())
+		}
+		reports = append(reports, objReport{pos, g.objName(obj)})
+	}
+	sort.Sort(reports)
+	return reports
+}
+
+// objGraph is the reachability graph over types.Objects declared by the
+// loaded packages: funcs, vars, consts, type names, struct fields, and
+// interface/concrete methods. An edge obj -> used means obj's definition
+// mentions used (a call, a field read, a method call, a satisfied
+// interface method, etc).
+type objGraph struct {
+	pkgs  []*packages.Package
+	decls map[types.Object]ast.Node // declarations we might report
+	used  map[types.Object]bool
+	info  map[*types.Package]*types.Info
+
+	// ifaces and concretes partition the named types we've seen by
+	// whether their underlying type is an interface, so that marking an
+	// interface method used can propagate to every concrete method that
+	// satisfies it.
+	ifaces    []*types.Named
+	concretes []*types.Named
+
+	// graph, when non-nil (i.e. -debug.graph was passed), records every
+	// edge the mark DFS below follows.
+	graph *Graph
+
+	// rootPkgs holds the packages matched directly by the patterns
+	// passed to doWhole, as opposed to the transitive dependencies
+	// packages.Visit pulls in alongside them.
+	rootPkgs map[*types.Package]bool
+
+	// ownerName records, for struct fields and interface methods (which
+	// unlike concrete methods carry no receiver type in their
+	// *types.Signature), the bare name of the type they belong to, so
+	// -ignore entries can be written as "pkg.Type.Field" the same way
+	// they are for the naive mode.
+	ownerName map[types.Object]string
+
+	// variants groups the types.Objects in decls that represent the same
+	// source declaration as type-checked by different package variants
+	// (see declKey), keyed by that source position. With Tests:true,
+	// packages.Load type-checks a package's base variant and its
+	// test-augmented variant separately, producing a distinct
+	// types.Object per variant for every decl; a reference from a test
+	// marks only the test variant's object, so reporting has to treat
+	// all of a decl's variants as one unit.
+	variants map[string][]types.Object
+}
+
+func newObjGraph(pkgs []*packages.Package) *objGraph {
+	g := &objGraph{
+		decls:     make(map[types.Object]ast.Node),
+		used:      make(map[types.Object]bool),
+		info:      make(map[*types.Package]*types.Info),
+		rootPkgs:  make(map[*types.Package]bool, len(pkgs)),
+		ownerName: make(map[types.Object]string),
+	}
+	for _, pkg := range pkgs {
+		if pkg.Types != nil {
+			g.rootPkgs[pkg.Types] = true
+		}
+	}
+	packages.Visit(pkgs, nil, func(pkg *packages.Package) {
+		g.pkgs = append(g.pkgs, pkg)
+		if pkg.Types == nil || pkg.TypesInfo == nil {
+			return
+		}
+		g.info[pkg.Types] = pkg.TypesInfo
+		for _, file := range pkg.Syntax {
+			g.collectDecls(pkg, file)
+		}
+	})
+
+	g.variants = make(map[string][]types.Object, len(g.decls))
+	for obj := range g.decls {
+		key := g.declKey(obj)
+		g.variants[key] = append(g.variants[key], obj)
+	}
+	return g
+}
+
+// declKey identifies the source declaration behind obj, shared by every
+// package variant that type-checks it (see the variants field doc). Two
+// objects from different variants of the same package declare the same
+// thing iff they were parsed from the same file:line:col, since variants
+// share the same unmodified source files.
+func (g *objGraph) declKey(obj types.Object) string {
+	fset := g.fsetFor(obj)
+	if fset == nil {
+		return g.objName(obj)
+	}
+	return fset.Position(obj.Pos()).String()
+}
+
+// anyVariantUsed reports whether obj, or any other package variant's
+// object standing in for the same source declaration, has been marked
+// used.
+func (g *objGraph) anyVariantUsed(obj types.Object) bool {
+	for _, v := range g.variants[g.declKey(obj)] {
+		if g.used[v] {
+			return true
+		}
+	}
+	return false
+}
+
+// collectDecls records every package-level func, var, const, type, struct
+// field, and interface/concrete method as a candidate for reporting.
+func (g *objGraph) collectDecls(pkg *packages.Package, file *ast.File) {
+	for _, decl := range file.Decls {
+		switch n := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range n.Specs {
+				switch s := spec.(type) {
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						if obj := pkg.TypesInfo.Defs[name]; obj != nil {
+							g.decls[obj] = n
+						}
+					}
+				case *ast.TypeSpec:
+					obj := pkg.TypesInfo.Defs[s.Name]
+					if obj == nil {
+						continue
+					}
+					g.decls[obj] = n
+					named, ok := obj.Type().(*types.Named)
+					if !ok {
+						continue
+					}
+					switch u := named.Underlying().(type) {
+					case *types.Struct:
+						g.concretes = append(g.concretes, named)
+						g.collectFields(pkg, s.Type, u, obj.Name())
+					case *types.Interface:
+						g.ifaces = append(g.ifaces, named)
+						g.collectInterfaceMethods(pkg, s.Type, obj.Name())
+					default:
+						g.concretes = append(g.concretes, named)
+					}
+				}
+			}
+		case *ast.FuncDecl:
+			if obj := pkg.TypesInfo.Defs[n.Name]; obj != nil {
+				g.decls[obj] = n
+			}
+		}
+	}
+}
+
+// collectFields records each field of a struct type as a candidate decl,
+// keyed by its *types.Var so Selections resolve straight to it.
+func (g *objGraph) collectFields(pkg *packages.Package, typeExpr ast.Expr, st *types.Struct, ownerName string) {
+	structType, ok := typeExpr.(*ast.StructType)
+	if !ok {
+		return
+	}
+	for i, field := range structType.Fields.List {
+		if len(field.Names) > 0 {
+			for _, name := range field.Names {
+				if obj := pkg.TypesInfo.Defs[name]; obj != nil {
+					g.decls[obj] = field
+					g.ownerName[obj] = ownerName
+				}
+			}
+			continue
+		}
+		// embedded field: there's no *ast.Ident naming it as a field, so
+		// pull the corresponding *types.Var straight off the struct.
+		if i < st.NumFields() {
+			g.decls[st.Field(i)] = field
+			g.ownerName[st.Field(i)] = ownerName
+		}
+	}
+}
+
+// collectInterfaceMethods records each method of an interface type as a
+// candidate decl.
+func (g *objGraph) collectInterfaceMethods(pkg *packages.Package, typeExpr ast.Expr, ownerName string) {
+	it, ok := typeExpr.(*ast.InterfaceType)
+	if !ok {
+		return
+	}
+	for _, method := range it.Methods.List {
+		for _, name := range method.Names {
+			if obj := pkg.TypesInfo.Defs[name]; obj != nil {
+				g.decls[obj] = method
+				g.ownerName[obj] = ownerName
+			}
+		}
+	}
+}
+
+// qualifiedNames returns every name -ignore should accept for obj: its
+// bare name, its package-qualified name, and, for methods, fields, and
+// interface methods, the "Type.Name" and "pkg.Type.Name" forms documented
+// in ignore.go.
+func (g *objGraph) qualifiedNames(obj types.Object) []string {
+	names := []string{obj.Name(), g.objName(obj)}
+
+	if owner := g.ownerOf(obj); owner != "" {
+		names = append(names, owner+"."+obj.Name())
+		if pkg := obj.Pkg(); pkg != nil {
+			names = append(names, pkg.Path()+"."+owner+"."+obj.Name())
+		}
+	}
+	return names
+}
+
+// markRoots marks every root of the program as used and transitively
+// marks everything reachable from the roots via types.Info.Uses and
+// types.Info.Selections.
+func (g *objGraph) markRoots() {
+	var roots []types.Object
+	for obj := range g.decls {
+		if isRoot(obj, g.rootPkgs[obj.Pkg()]) {
+			roots = append(roots, obj)
+		}
+	}
+	for _, obj := range roots {
+		g.graph.addRoot(g.objName(obj))
+		g.mark(obj)
+	}
+}
+
+// markEscapeHatches marks declarations reachable via //go:linkname,
+// // deadcode:keep, reflect.TypeOf/ValueOf, and -ignore, the same escape
+// hatches applyEscapeHatches adds for the naive mode, layered on top of
+// the objGraph built by markRoots.
+func (g *objGraph) markEscapeHatches() {
+	byPkgAndName := make(map[*types.Package]map[string][]types.Object)
+	byName := make(map[string][]types.Object)
+	for obj := range g.decls {
+		m, ok := byPkgAndName[obj.Pkg()]
+		if !ok {
+			m = make(map[string][]types.Object)
+			byPkgAndName[obj.Pkg()] = m
+		}
+		m[obj.Name()] = append(m[obj.Name()], obj)
+		byName[obj.Name()] = append(byName[obj.Name()], obj)
+	}
+
+	for _, pkg := range g.pkgs {
+		if pkg.Types == nil {
+			continue
+		}
+		names := byPkgAndName[pkg.Types]
+		for _, file := range pkg.Syntax {
+			for _, name := range linknameTargets(file) {
+				for _, obj := range names[name] {
+					g.mark(obj)
+				}
+			}
+			for _, name := range pragmaKeepNames(file) {
+				for _, obj := range names[name] {
+					g.mark(obj)
+				}
+			}
+			for _, name := range reflectEscapes(file) {
+				// The type passed to reflect may be declared in a
+				// different package than the call site (reflectEscapes
+				// strips the package qualifier off e.g. otherpkg.Foo{}),
+				// so look it up program-wide rather than just in pkg.
+				for _, obj := range byName[name] {
+					g.mark(obj)
+					if named, ok := namedOf(obj.Type()); ok {
+						for i := 0; i < named.NumMethods(); i++ {
+							g.mark(named.Method(i))
+						}
+					}
+				}
+			}
+		}
+	}
+
+	for obj := range g.decls {
+		if theIgnore.matches(g.qualifiedNames(obj)...) {
+			g.mark(obj)
+		}
+	}
+}
+
+// isRoot reports whether obj should be treated as a reachability root:
+// main.main, any init, tests, and (for identifiers declared directly in a
+// root package, i.e. one of the patterns passed on the command line)
+// exported package-level funcs, vars, consts and types. Struct fields and
+// methods are never roots on their own: they only become reachable via an
+// actual selection, a satisfied interface, or a reflect/linkname escape
+// hatch, which is the whole point of this mode over the naive one.
+func isRoot(obj types.Object, isRootPkg bool) bool {
+	if isFieldOrMethod(obj) {
+		return false
+	}
+	name := obj.Name()
+	if name == "init" {
+		return true
+	}
+	if obj.Pkg() != nil && obj.Pkg().Name() == "main" && name == "main" {
+		return true
+	}
+	if strings.HasPrefix(name, "Test") || strings.HasPrefix(name, "Benchmark") || strings.HasPrefix(name, "Example") {
+		return true
+	}
+	// Exported decls of a root package are assumed to be part of its
+	// public API, reachable from importers this run doesn't see -- except
+	// in a main package, which has no importers and whose only real entry
+	// point is main() (handled above); an exported main-package symbol
+	// that nothing in this program calls is genuinely dead.
+	if isRootPkg && obj.Exported() && (obj.Pkg() == nil || obj.Pkg().Name() != "main") {
+		return true
+	}
+	return false
+}
+
+// isFieldOrMethod reports whether obj is a struct field or a method
+// (a func with a receiver), as opposed to a package-level declaration.
+func isFieldOrMethod(obj types.Object) bool {
+	switch o := obj.(type) {
+	case *types.Var:
+		return o.IsField()
+	case *types.Func:
+		return o.Type().(*types.Signature).Recv() != nil
+	}
+	return false
+}
+
+// mark performs a DFS over the uses graph starting at obj, marking every
+// object it transitively mentions as used, and propagating through
+// interface satisfaction when obj is an interface method.
+func (g *objGraph) mark(obj types.Object) {
+	if g.used[obj] {
+		return
+	}
+	g.used[obj] = true
+	g.propagateSatisfaction(obj)
+
+	decl, ok := g.decls[obj]
+	if !ok {
+		return
+	}
+	info := g.info[obj.Pkg()]
+	if info == nil {
+		return
+	}
+	g.markInterfaceConversions(obj, decl, info)
+
+	fset := g.fsetFor(obj)
+	at := func(pos token.Pos) string {
+		if fset == nil {
+			return ""
+		}
+		return fset.Position(pos).String()
+	}
+	ast.Inspect(decl, func(n ast.Node) bool {
+		switch e := n.(type) {
+		case *ast.SelectorExpr:
+			if sel, ok := info.Selections[e]; ok {
+				g.graph.addEdge(g.objName(obj), g.objName(sel.Obj()), at(e.Pos()))
+				g.mark(sel.Obj())
+				return true // still descend, in case of nested calls in e.X
+			}
+			if used := info.Uses[e.Sel]; used != nil {
+				g.graph.addEdge(g.objName(obj), g.objName(used), at(e.Pos()))
+				g.mark(used) // qualified package identifier, e.g. pkg.Foo
+			}
+		case *ast.Ident:
+			if used := info.Uses[e]; used != nil {
+				g.graph.addEdge(g.objName(obj), g.objName(used), at(e.Pos()))
+				g.mark(used)
+			}
+		}
+		return true
+	})
+}
+
+// fsetFor returns the token.FileSet that positions in obj's package were
+// parsed with, for formatting file:line edge labels.
+func (g *objGraph) fsetFor(obj types.Object) *token.FileSet {
+	for _, pkg := range g.pkgs {
+		if pkg.Types == obj.Pkg() {
+			return pkg.Fset
+		}
+	}
+	return nil
+}
+
+// propagateSatisfaction marks the corresponding concrete method used on
+// every concrete type that implements obj's interface, when obj is itself
+// an interface method that has just become reachable.
+func (g *objGraph) propagateSatisfaction(obj types.Object) {
+	fn, ok := obj.(*types.Func)
+	if !ok {
+		return
+	}
+	sig, ok := fn.Type().(*types.Signature)
+	if !ok || sig.Recv() == nil {
+		return
+	}
+	recv, ok := namedOf(sig.Recv().Type())
+	if !ok {
+		return
+	}
+	iface, ok := recv.Underlying().(*types.Interface)
+	if !ok {
+		return
+	}
+	for _, concrete := range g.concretes {
+		if !types.Implements(concrete, iface) && !types.Implements(types.NewPointer(concrete), iface) {
+			continue
+		}
+		if m := methodByName(concrete, fn.Name()); m != nil {
+			g.mark(m)
+		}
+	}
+}
+
+// markInterfaceConversions walks decl looking for the places a concrete
+// value is returned, assigned, or passed as an interface it implements:
+// a return against a declared result type, an assignment or var decl
+// against its type, a struct literal field, and a call argument against
+// the callee's parameter type. Go requires the full method set to exist
+// for any of those to type-check, so the satisfying methods are reachable
+// as soon as the conversion site is, even if no call ever dynamically
+// dispatches through the interface (propagateSatisfaction above handles
+// that complementary, call-driven case).
+func (g *objGraph) markInterfaceConversions(obj types.Object, decl ast.Node, info *types.Info) {
+	sig, _ := obj.(*types.Func)
+	var sigStack []*types.Signature
+	if sig != nil {
+		sigStack = []*types.Signature{sig.Type().(*types.Signature)}
+	} else {
+		sigStack = []*types.Signature{nil}
+	}
+	ast.Inspect(decl, func(n ast.Node) bool {
+		if n == nil {
+			sigStack = sigStack[:len(sigStack)-1]
+			return true
+		}
+		enclosing := sigStack[len(sigStack)-1]
+		switch e := n.(type) {
+		case *ast.FuncLit:
+			if tv, ok := info.Types[e]; ok {
+				if s, ok := tv.Type.(*types.Signature); ok {
+					enclosing = s
+				}
+			}
+		case *ast.ReturnStmt:
+			if enclosing != nil {
+				results := enclosing.Results()
+				for i, r := range e.Results {
+					if i >= results.Len() {
+						break
+					}
+					if tv, ok := info.Types[r]; ok {
+						g.markSatisfying(results.At(i).Type(), tv.Type)
+					}
+				}
+			}
+		case *ast.AssignStmt:
+			for i, lhs := range e.Lhs {
+				if i >= len(e.Rhs) {
+					break
+				}
+				lt, lok := info.Types[lhs]
+				rt, rok := info.Types[e.Rhs[i]]
+				if lok && rok {
+					g.markSatisfying(lt.Type, rt.Type)
+				}
+			}
+		case *ast.ValueSpec:
+			if e.Type != nil {
+				if tt, ok := info.Types[e.Type]; ok {
+					for _, val := range e.Values {
+						if vt, ok := info.Types[val]; ok {
+							g.markSatisfying(tt.Type, vt.Type)
+						}
+					}
+				}
+			}
+		case *ast.CompositeLit:
+			g.markCompositeLitConversions(info, e)
+		case *ast.CallExpr:
+			g.markCallArgConversions(info, e)
+		}
+		sigStack = append(sigStack, enclosing)
+		return true
+	})
+}
+
+// markSatisfying marks the concrete methods of src's type required to
+// satisfy target, when target is an interface type that src's (concrete)
+// type implements; a no-op otherwise.
+func (g *objGraph) markSatisfying(target, src types.Type) {
+	iface, ok := ifaceUnderlying(target)
+	if !ok {
+		return
+	}
+	concrete, ok := namedOf(src)
+	if !ok {
+		return
+	}
+	if _, ok := concrete.Underlying().(*types.Interface); ok {
+		return // src is itself an interface value, not a concrete type
+	}
+	if !types.Implements(concrete, iface) && !types.Implements(types.NewPointer(concrete), iface) {
+		return
+	}
+	for i := 0; i < iface.NumMethods(); i++ {
+		if m := methodByName(concrete, iface.Method(i).Name()); m != nil {
+			g.mark(m)
+		}
+	}
+}
+
+// markCompositeLitConversions checks the elements of a struct, slice,
+// array, or map literal against the field/element/key type they're typed
+// against, in case that type is an interface and the element is a
+// concrete conversion.
+func (g *objGraph) markCompositeLitConversions(info *types.Info, lit *ast.CompositeLit) {
+	tv, ok := info.Types[lit]
+	if !ok {
+		return
+	}
+	t := tv.Type
+	if named, ok := t.(*types.Named); ok {
+		t = named.Underlying()
+	}
+	switch u := t.(type) {
+	case *types.Struct:
+		g.markStructLitConversions(info, lit, u)
+	case *types.Slice:
+		g.markSeqLitConversions(info, lit, u.Elem())
+	case *types.Array:
+		g.markSeqLitConversions(info, lit, u.Elem())
+	case *types.Map:
+		g.markMapLitConversions(info, lit, u)
+	}
+}
+
+// markStructLitConversions checks each struct-literal field's value
+// against its declared field type.
+func (g *objGraph) markStructLitConversions(info *types.Info, lit *ast.CompositeLit, st *types.Struct) {
+	pos := 0
+	for _, elt := range lit.Elts {
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			ident, ok := kv.Key.(*ast.Ident)
+			if !ok {
+				continue
+			}
+			for i := 0; i < st.NumFields(); i++ {
+				if st.Field(i).Name() == ident.Name {
+					if vt, ok := info.Types[kv.Value]; ok {
+						g.markSatisfying(st.Field(i).Type(), vt.Type)
+					}
+					break
+				}
+			}
+			continue
+		}
+		if pos < st.NumFields() {
+			if vt, ok := info.Types[elt]; ok {
+				g.markSatisfying(st.Field(pos).Type(), vt.Type)
+			}
+		}
+		pos++
+	}
+}
+
+// markSeqLitConversions checks each element of a slice or array literal
+// against its element type (a keyed element, e.g. "[5]Greeter{2: x}",
+// still carries its value in KeyValueExpr.Value).
+func (g *objGraph) markSeqLitConversions(info *types.Info, lit *ast.CompositeLit, elem types.Type) {
+	for _, elt := range lit.Elts {
+		if kv, ok := elt.(*ast.KeyValueExpr); ok {
+			elt = kv.Value
+		}
+		if vt, ok := info.Types[elt]; ok {
+			g.markSatisfying(elem, vt.Type)
+		}
+	}
+}
+
+// markMapLitConversions checks each key and value of a map literal
+// against the map's key and element types.
+func (g *objGraph) markMapLitConversions(info *types.Info, lit *ast.CompositeLit, m *types.Map) {
+	for _, elt := range lit.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if kt, ok := info.Types[kv.Key]; ok {
+			g.markSatisfying(m.Key(), kt.Type)
+		}
+		if vt, ok := info.Types[kv.Value]; ok {
+			g.markSatisfying(m.Elem(), vt.Type)
+		}
+	}
+}
+
+// markCallArgConversions checks call against the callee's declared
+// parameter types, in case a parameter is interface-typed and the
+// argument is a concrete conversion. call.Fun may also name a type
+// directly rather than a callable signature, for an explicit conversion
+// like Iface(x); that's an interface conversion in its own right.
+func (g *objGraph) markCallArgConversions(info *types.Info, call *ast.CallExpr) {
+	tv, ok := info.Types[call.Fun]
+	if !ok {
+		return
+	}
+	if tv.IsType() {
+		if len(call.Args) == 1 {
+			if at, ok := info.Types[call.Args[0]]; ok {
+				g.markSatisfying(tv.Type, at.Type)
+			}
+		}
+		return
+	}
+	sig, ok := tv.Type.(*types.Signature)
+	if !ok {
+		return
+	}
+	params := sig.Params()
+	for i, arg := range call.Args {
+		pt := paramTypeAt(params, i, sig.Variadic())
+		if pt == nil {
+			continue
+		}
+		if at, ok := info.Types[arg]; ok {
+			g.markSatisfying(pt, at.Type)
+		}
+	}
+}
+
+// paramTypeAt returns the type a call argument at position i is assigned
+// to, unwrapping the trailing "...T" variadic parameter to its element
+// type T for positions at or past it.
+func paramTypeAt(params *types.Tuple, i int, variadic bool) types.Type {
+	n := params.Len()
+	if n == 0 {
+		return nil
+	}
+	if i < n && (!variadic || i < n-1) {
+		return params.At(i).Type()
+	}
+	if !variadic {
+		return nil
+	}
+	if s, ok := params.At(n - 1).Type().(*types.Slice); ok {
+		return s.Elem()
+	}
+	return nil
+}
+
+// ifaceUnderlying returns t's interface type, whether t is itself an
+// unnamed interface type or a named type whose underlying type is one.
+func ifaceUnderlying(t types.Type) (*types.Interface, bool) {
+	switch u := t.(type) {
+	case *types.Named:
+		iface, ok := u.Underlying().(*types.Interface)
+		return iface, ok
+	case *types.Interface:
+		return u, true
+	}
+	return nil, false
+}
+
+func namedOf(t types.Type) (*types.Named, bool) {
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	n, ok := t.(*types.Named)
+	return n, ok
+}
+
+func methodByName(named *types.Named, name string) types.Object {
+	for i := 0; i < named.NumMethods(); i++ {
+		if m := named.Method(i); m.Name() == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// ownerOf returns the name of the type obj belongs to: the receiver type
+// for a method, or the struct/interface that declares it for a field or
+// interface method (tracked separately in ownerName, since those have no
+// receiver of their own to read it off). Empty for package-level decls.
+func (g *objGraph) ownerOf(obj types.Object) string {
+	if owner := g.ownerName[obj]; owner != "" {
+		return owner
+	}
+	if fn, ok := obj.(*types.Func); ok {
+		if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+			if named, ok := namedOf(recv.Type()); ok {
+				return named.Obj().Name()
+			}
+		}
+	}
+	return ""
+}
+
+// objName returns the reachability-graph/report name for obj:
+// "pkg.Name" for package-level declarations, and "pkg.Owner.Name" for
+// methods, struct fields, and interface methods, so that e.g. two
+// unrelated String methods on different types don't collide in reports.
+func (g *objGraph) objName(obj types.Object) string {
+	name := obj.Name()
+	if owner := g.ownerOf(obj); owner != "" {
+		name = owner + "." + name
+	}
+	if pkg := obj.Pkg(); pkg != nil {
+		return pkg.Path() + "." + name
+	}
+	return name
+}
+
+type objReport struct {
+	pos  token.Position
+	name string
+}
+type objReports []objReport
+
+func (l objReports) Len() int      { return len(l) }
+func (l objReports) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l objReports) Less(i, j int) bool {
+	if l[i].pos.Filename != l[j].pos.Filename {
+		return l[i].pos.Filename < l[j].pos.Filename
+	}
+	return l[i].pos.Line < l[j].pos.Line
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// runWhole writes files (paths relative to a scratch module root) to a
+// temp directory, loads the module the same way doWhole does, and runs
+// the reachability graph through markRoots/markEscapeHatches so tests can
+// inspect which declarations end up dead.
+func runWhole(t *testing.T, files map[string]string) *objGraph {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		full := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &packages.Config{Mode: wholeProgramLoadMode, Tests: true, Dir: dir}
+	pkgs, err := packages.Load(cfg, "./...")
+	if err != nil {
+		t.Fatalf("loading packages: %v", err)
+	}
+	if packages.PrintErrors(pkgs) > 0 {
+		t.Fatalf("scratch module failed to type-check")
+	}
+
+	g := newObjGraph(pkgs)
+	g.markRoots()
+	g.markEscapeHatches()
+	return g
+}
+
+// deadNames returns the objName of every declaration runWhole's graph
+// reports as dead.
+func deadNames(g *objGraph) []string {
+	var names []string
+	for _, r := range g.deadDecls() {
+		names = append(names, r.name)
+	}
+	return names
+}
+
+func containsSuffix(names []string, suffix string) bool {
+	for _, n := range names {
+		if strings.HasSuffix(n, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+const goModHeader = "module example.com/m\n\ngo 1.21\n"
+
+// A declaration used only by a same-package test must not be reported
+// dead: packages.Load(Tests:true) type-checks the base package and its
+// test-augmented variant separately, producing two distinct types.Objects
+// for the same source decl, and the test only reaches the latter.
+func TestWholeTestOnlyUsageIsNotDead(t *testing.T) {
+	g := runWhole(t, map[string]string{
+		"go.mod": goModHeader,
+		"lib/lib.go": `package lib
+
+func Helper() {
+	onlyTestUses()
+}
+
+func onlyTestUses() {}
+`,
+		"lib/lib_test.go": `package lib
+
+import "testing"
+
+func TestOnlyTestUses(t *testing.T) {
+	onlyTestUses()
+}
+`,
+		"main.go": `package main
+
+import "example.com/m/lib"
+
+func main() {
+	lib.Helper()
+}
+`,
+	})
+	if dead := deadNames(g); containsSuffix(dead, ".onlyTestUses") {
+		t.Errorf("onlyTestUses reported dead despite being used only by a test: %v", dead)
+	}
+}
+
+// A concrete method called through an interface value stays alive, the
+// already-working case propagateSatisfaction was built for.
+func TestWholeInterfaceSatisfactionCalled(t *testing.T) {
+	g := runWhole(t, map[string]string{
+		"go.mod": goModHeader,
+		"main.go": `package main
+
+type Stringer interface {
+	String() string
+}
+
+type T struct{}
+
+func (T) String() string { return "T" }
+
+func main() {
+	var s Stringer = T{}
+	println(s.String())
+}
+`,
+	})
+	if dead := deadNames(g); containsSuffix(dead, ".T.String") {
+		t.Errorf("T.String reported dead despite satisfying a called interface method: %v", dead)
+	}
+}
+
+// A concrete method required only to satisfy an interface conversion
+// (never called through the interface) must still stay alive: Go
+// requires the full method set for the conversion to type-check, so
+// deleting it breaks the build regardless of whether anything ever
+// dynamically dispatches through Stringer.
+func TestWholeInterfaceSatisfactionAssignOnly(t *testing.T) {
+	g := runWhole(t, map[string]string{
+		"go.mod": goModHeader,
+		"main.go": `package main
+
+import "fmt"
+
+type Stringer interface {
+	String() string
+}
+
+type T struct{}
+
+func (T) String() string { return "T" }
+
+func use() Stringer {
+	return T{}
+}
+
+func main() {
+	fmt.Println(use())
+}
+`,
+	})
+	if dead := deadNames(g); containsSuffix(dead, ".T.String") {
+		t.Errorf("T.String reported dead despite being required to satisfy Stringer in use(): %v", dead)
+	}
+}
+
+// Two distinct String methods (one on the interface, one on the concrete
+// type satisfying it) must be reported under distinct, owner-qualified
+// names, not collide on a single "pkg.String is unused" line.
+func TestWholeMethodNameIncludesOwner(t *testing.T) {
+	g := runWhole(t, map[string]string{
+		"go.mod": goModHeader,
+		"main.go": `package main
+
+type Stringer interface {
+	String() string
+}
+
+type T struct{}
+
+func (T) String() string { return "T" }
+
+func use() Stringer {
+	return T{}
+}
+
+func main() {
+	_ = use()
+}
+`,
+	})
+	dead := deadNames(g)
+	if !containsSuffix(dead, ".Stringer.String") {
+		t.Errorf("want Stringer.String reported dead (never called), got %v", dead)
+	}
+	if containsSuffix(dead, ".T.String") {
+		t.Errorf("T.String should not be reported dead (pinned by the conversion in use()): %v", dead)
+	}
+}
+
+// A struct field never referenced anywhere is reported dead with its
+// owning type, while a field that is read stays alive.
+func TestWholeFieldReachability(t *testing.T) {
+	g := runWhole(t, map[string]string{
+		"go.mod": goModHeader,
+		"main.go": `package main
+
+import "fmt"
+
+type T struct {
+	Used   int
+	Unused int
+}
+
+func main() {
+	t := T{Used: 1}
+	fmt.Println(t.Used)
+}
+`,
+	})
+	dead := deadNames(g)
+	if !containsSuffix(dead, ".T.Unused") {
+		t.Errorf("want T.Unused reported dead, got %v", dead)
+	}
+	if containsSuffix(dead, ".T.Used") {
+		t.Errorf("T.Used should not be reported dead: %v", dead)
+	}
+}
+
+// A concrete method required only to satisfy an interface conversion
+// inside a slice literal must stay alive, the same as the single-value
+// assign-only case: the literal doesn't type-check unless the element's
+// full method set satisfies the slice's interface element type.
+func TestWholeInterfaceSatisfactionSliceLit(t *testing.T) {
+	g := runWhole(t, map[string]string{
+		"go.mod": goModHeader,
+		"main.go": `package main
+
+type Greeter interface {
+	Greet() string
+}
+
+type En struct{}
+
+func (En) Greet() string { return "hello" }
+
+var registry = []Greeter{En{}}
+
+func main() {
+	_ = registry
+}
+`,
+	})
+	if dead := deadNames(g); containsSuffix(dead, ".En.Greet") {
+		t.Errorf("En.Greet reported dead despite being required by the []Greeter{En{}} literal: %v", dead)
+	}
+}
+
+// Same as above, but for a map literal's value type.
+func TestWholeInterfaceSatisfactionMapLit(t *testing.T) {
+	g := runWhole(t, map[string]string{
+		"go.mod": goModHeader,
+		"main.go": `package main
+
+type Greeter interface {
+	Greet() string
+}
+
+type B struct{}
+
+func (B) Greet() string { return "hi" }
+
+var registry = map[string]Greeter{"x": B{}}
+
+func main() {
+	_ = registry
+}
+`,
+	})
+	if dead := deadNames(g); containsSuffix(dead, ".B.Greet") {
+		t.Errorf("B.Greet reported dead despite being required by the map[string]Greeter{\"x\": B{}} literal: %v", dead)
+	}
+}
+
+// An explicit conversion to an interface type, e.g. Greeter(x), requires
+// x's full method set the same as an implicit assignment conversion does.
+func TestWholeInterfaceSatisfactionExplicitConversion(t *testing.T) {
+	g := runWhole(t, map[string]string{
+		"go.mod": goModHeader,
+		"main.go": `package main
+
+import "fmt"
+
+type Greeter interface {
+	Greet() string
+}
+
+type Fr struct{}
+
+func (Fr) Greet() string { return "bonjour" }
+
+func main() {
+	fmt.Println(Greeter(Fr{}))
+}
+`,
+	})
+	if dead := deadNames(g); containsSuffix(dead, ".Fr.Greet") {
+		t.Errorf("Fr.Greet reported dead despite being required by the Greeter(Fr{}) conversion: %v", dead)
+	}
+}
+
+// A method promoted from an embedded struct is reported against the
+// embedded type, and calling the promoted method through the outer type
+// keeps it alive.
+func TestWholeEmbeddedMethodReachability(t *testing.T) {
+	g := runWhole(t, map[string]string{
+		"go.mod": goModHeader,
+		"main.go": `package main
+
+type Base struct{}
+
+func (Base) Used() {}
+func (Base) Unused() {}
+
+type T struct {
+	Base
+}
+
+func main() {
+	var t T
+	t.Used()
+}
+`,
+	})
+	dead := deadNames(g)
+	if !containsSuffix(dead, ".Base.Unused") {
+		t.Errorf("want Base.Unused reported dead, got %v", dead)
+	}
+	if containsSuffix(dead, ".Base.Used") {
+		t.Errorf("Base.Used should not be reported dead: %v", dead)
+	}
+}
+
+// An exported decl in a main package has no importers to be reachable
+// from, unlike an exported decl in a library package, so it must not be
+// auto-rooted just for being exported.
+func TestWholeMainPackageExportedIsNotAutoRoot(t *testing.T) {
+	g := runWhole(t, map[string]string{
+		"go.mod": goModHeader,
+		"main.go": `package main
+
+func Unused() {}
+
+func main() {}
+`,
+	})
+	if dead := deadNames(g); !containsSuffix(dead, ".Unused") {
+		t.Errorf("want Unused reported dead in a main package despite being exported, got %v", dead)
+	}
+}